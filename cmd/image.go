@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/ericpauley/go-quantize/quantize"
+)
+
+// encodeOptions controls how encodeImage rasterises an image.Image into a
+// specific wire format.
+type encodeOptions struct {
+	// Quality is the JPEG encoding quality, 1-100. Ignored for other formats.
+	Quality int
+	// Colors is the GIF palette size, 2-256. Ignored for other formats.
+	Colors int
+}
+
+// encodeImage encodes img as format ("png", "jpg"/"jpeg", or "gif") using
+// opts, and returns the encoded bytes alongside the Content-Type header
+// value to serve them with. It exists so handler, and anything else that
+// needs to turn a decoded screenshot into response bytes, doesn't have to
+// duplicate the per-format encoding logic.
+func encodeImage(img image.Image, format string, opts encodeOptions) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	switch format {
+	case "", "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+
+	case "jpg", "jpeg":
+		quality := opts.Quality
+		if quality < 1 || quality > 100 {
+			quality = jpeg.DefaultQuality
+		}
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+
+	case "gif":
+		colors := opts.Colors
+		if colors < 2 || colors > 256 {
+			colors = 256
+		}
+		// gif.Encode falls back to a fixed, static palette (palette.Plan9)
+		// when Quantizer is nil, which isn't adaptive to the screenshot's
+		// actual colors and looks badly discolored at low color counts.
+		// Median-cut quantization picks a palette from the image itself.
+		gifOpts := &gif.Options{
+			NumColors: colors,
+			Quantizer: quantize.MedianCutQuantizer{},
+		}
+		if err := gif.Encode(&buf, img, gifOpts); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/gif", nil
+
+	default:
+		return nil, "", fmt.Errorf("unsupported format %q, want one of png, jpg, gif", format)
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 60), G: uint8(y * 60), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestEncodeImage(t *testing.T) {
+	img := testImage()
+
+	tests := []struct {
+		name            string
+		format          string
+		opts            encodeOptions
+		wantContentType string
+		wantErr         bool
+	}{
+		{name: "default format is png", format: "", wantContentType: "image/png"},
+		{name: "explicit png", format: "png", wantContentType: "image/png"},
+		{name: "jpg with default quality", format: "jpg", wantContentType: "image/jpeg"},
+		{name: "jpeg alias with explicit quality", format: "jpeg", opts: encodeOptions{Quality: 50}, wantContentType: "image/jpeg"},
+		{name: "jpg with out of range quality falls back", format: "jpg", opts: encodeOptions{Quality: 1000}, wantContentType: "image/jpeg"},
+		{name: "gif with default colors", format: "gif", wantContentType: "image/gif"},
+		{name: "gif with explicit colors", format: "gif", opts: encodeOptions{Colors: 4}, wantContentType: "image/gif"},
+		{name: "gif with out of range colors falls back", format: "gif", opts: encodeOptions{Colors: 0}, wantContentType: "image/gif"},
+		{name: "unsupported format errors", format: "bmp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, contentType, err := encodeImage(img, tt.format, tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("encodeImage(%q) expected an error, got none", tt.format)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("encodeImage(%q) unexpected error: %v", tt.format, err)
+			}
+			if contentType != tt.wantContentType {
+				t.Errorf("encodeImage(%q) content-type = %q, want %q", tt.format, contentType, tt.wantContentType)
+			}
+			if len(out) == 0 {
+				t.Errorf("encodeImage(%q) produced no bytes", tt.format)
+			}
+
+			decoded, _, err := image.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatalf("encodeImage(%q) output did not decode: %v", tt.format, err)
+			}
+			if decoded.Bounds() != img.Bounds() {
+				t.Errorf("encodeImage(%q) bounds = %v, want %v", tt.format, decoded.Bounds(), img.Bounds())
+			}
+		})
+	}
+}
@@ -2,10 +2,11 @@ package cmd
 
 import (
 	"bytes"
+	"errors"
 	"image"
-	"image/jpeg"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 
@@ -23,23 +24,62 @@ The server starts its own webserver, and when invoked with the url query paramet
 instructs the underlying Chrome instance to take a screenshot and return it as
 the HTTP response.
 
-NOTE: When changing the server address to something other than localhost, make 
+NOTE: When changing the server address to something other than localhost, make
 sure that only authorised connections can be made to the server port. By default,
 access is restricted to localhost to reduce the risk of SSRF attacks against the
 host or hosting infrastructure (AWS/Azure/GCP, etc). Consider strict IP filtering
 or fronting this server with an authentication aware reverse proxy.
 
 Allowed URLs, by default, need to start with http:// or https://. If you need
-this restriction lifted, add the --allow-insecure-uri / -A flag. A word of 
+this restriction lifted, add the --allow-insecure-uri / -A flag. A word of
 warning though, that also means that someone may request a URL like file:///etc/passwd.
 
+Every request is also run through a validation subsystem before chrome ever sees the
+URL: hosts resolving to private/reserved addresses (RFC1918, loopback, link-local,
+CGNAT, IPv6 ULA) are rejected unless --allow-private is set, and --allow-host/--deny-host
+let you restrict requests to a set of glob (or, prefixed with "~", regex) host
+patterns. These checks, plus per-connection dial-time re-validation, apply to every
+endpoint, but --max-redirects itself - bounding how many hops a target may redirect
+through before a follow-up request is refused - is only enforced on /browse, which is
+the only endpoint that drives chrome through a navigation-event-aware path; the
+primary / endpoint and POST /jobs rely solely on dial-time validation and do not cap
+redirect chain length. If you need to expose this server publicly,
+set --hmac-key and have an upstream, trusted application sign URLs with
+HMAC-SHA256(key, url), passing the hex digest as ?sig=...; requests with a missing
+or invalid signature are rejected with 403.
+
 Assuming the server is hosted on localhost, an HTTP GET request to
 take a screenshot of google.com would be:
 	http://localhost:7171/?url=https://www.google.com
 	
 Optionally the request supports resizing to fit given width and height in request. This
 keeps the original viewport of chrome equal to resolution given in program arguments.
-	http://localhost:7171/?url=https://www.google.com&width=1280&height=720`,
+	http://localhost:7171/?url=https://www.google.com&width=1280&height=720
+
+The response format defaults to png, but can be switched to jpg or gif with the format
+query parameter. jpg accepts a quality (1-100), and gif accepts a colors (2-256) palette
+size for clients that only handle indexed images.
+	http://localhost:7171/?url=https://www.google.com&format=jpg&quality=80
+	http://localhost:7171/?url=https://www.google.com&format=gif&colors=16
+
+For clients that cannot run JavaScript (legacy and text browsers), /browse renders the
+page and returns an HTML imagemap that can be clicked to navigate, with /screenshot
+serving the underlying image. Add &p=1, &p=2, etc. to page down a tall page.
+	http://localhost:7171/browse?url=https://www.google.com
+
+Every response carries hardening headers (nosniff, frame deny, a strict CSP, and HSTS
+when served over TLS). --rps/--burst rate limit requests per client ip, --tls-cert/
+--tls-key serve over HTTPS, and --basic-auth gates the whole server behind a single
+user:pass credential - making the "expose to other networks" warning above actionable.
+
+Screenshots can take many seconds, which ties up an HTTP goroutine and a chrome tab
+for the whole request if taken synchronously. POST /jobs with a JSON body (url, width,
+height, format, quality, colors, wait_for_selector, delay_ms, callback_url) queues the
+screenshot on a --workers sized worker pool and returns immediately with {id,
+status_url}; GET /jobs/{id} then returns pending/running/done/failed, serving the image
+once done. The queue is bounded by --queue-size, returning 429 once full. If
+callback_url is set, gowitness POSTs a small JSON result envelope to it once the job
+finishes instead of making the caller poll.`,
 	Example: `$ gowitness server
 $ gowitness server --addr 0.0.0.0:8080`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -49,9 +89,54 @@ $ gowitness server --addr 0.0.0.0:8080`,
 			log.Warn().Msg("exposing this server to other networks is dangerous! see the server command help for more information")
 		}
 
-		http.HandleFunc("/", handler)
+		proxy, err := ensureSSRFProxy()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to start the ssrf-validating proxy")
+		}
+		// Every chrome process this server starts - our own chromedp
+		// sessions for /browse and /jobs, or the one behind chrm.Screenshot
+		// for "/" - picks this up as its system proxy, so the
+		// allow/deny/private-IP checks are enforced at the moment chrome
+		// actually connects, for every redirect hop, not just the first
+		// request. See server_proxy.go for why that matters.
+		os.Setenv("HTTP_PROXY", "http://"+proxy.addr())
+		os.Setenv("HTTPS_PROXY", "http://"+proxy.addr())
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", handler)
+		mux.HandleFunc("/browse", browseHandler)
+		mux.HandleFunc("/screenshot", browseScreenshotByIDHandler)
+		mux.HandleFunc("/jobs", jobsCreateHandler)
+		mux.HandleFunc("/jobs/", jobsStatusHandler)
+		go browseCacheJanitor()
+		startJobWorkers(options.Workers, options.QueueSize)
+
+		var rl *rateLimiter
+		if options.RPS > 0 {
+			rl = newRateLimiter(options.RPS, options.Burst)
+		}
+
+		// rateLimit wraps basicAuth, not the other way around, so that a
+		// flood of bad credentials against --basic-auth is throttled the
+		// same as any other request - otherwise failed-auth requests would
+		// 401 out before ever reaching the limiter and --rps/--burst would
+		// do nothing against exactly the credential-guessing traffic
+		// they're meant to cover.
+		var root http.Handler = mux
+		root = basicAuth(root)
+		root = rateLimit(rl, root)
+		root = securityHeaders(root)
+
 		log.Info().Str("address", options.ServerAddr).Msg("server listening")
-		if err := http.ListenAndServe(options.ServerAddr, nil); err != nil {
+
+		if options.TLSCert != "" || options.TLSKey != "" {
+			if err := http.ListenAndServeTLS(options.ServerAddr, options.TLSCert, options.TLSKey, root); err != nil {
+				log.Fatal().Err(err).Msg("webserver failed")
+			}
+			return
+		}
+
+		if err := http.ListenAndServe(options.ServerAddr, root); err != nil {
 			log.Fatal().Err(err).Msg("webserver failed")
 		}
 	},
@@ -62,6 +147,18 @@ func init() {
 
 	serverCmd.Flags().StringVarP(&options.ServerAddr, "address", "a", "localhost:7171", "server listening address")
 	serverCmd.Flags().BoolVarP(&options.AllowInsecureURIs, "allow-insecure-uri", "A", false, "allow uris that dont start with http(s)")
+	serverCmd.Flags().StringSliceVar(&options.AllowHosts, "allow-host", nil, "only allow urls whose host matches this glob (or ~regex) pattern (repeatable)")
+	serverCmd.Flags().StringSliceVar(&options.DenyHosts, "deny-host", nil, "reject urls whose host matches this glob (or ~regex) pattern (repeatable)")
+	serverCmd.Flags().BoolVar(&options.AllowPrivate, "allow-private", false, "allow urls that resolve to a private/reserved ip address")
+	serverCmd.Flags().IntVar(&options.MaxRedirects, "max-redirects", 5, "maximum number of redirects to follow before refusing a url")
+	serverCmd.Flags().StringVar(&options.HMACKey, "hmac-key", "", "if set, only accept urls signed with hex(HMAC-SHA256(key, url)) as ?sig=...")
+	serverCmd.Flags().Float64Var(&options.RPS, "rps", 0, "requests per second to allow per client ip (0 disables rate limiting)")
+	serverCmd.Flags().IntVar(&options.Burst, "burst", 5, "burst size for the --rps token bucket")
+	serverCmd.Flags().StringVar(&options.TLSCert, "tls-cert", "", "path to a TLS certificate, enables HTTPS when set alongside --tls-key")
+	serverCmd.Flags().StringVar(&options.TLSKey, "tls-key", "", "path to a TLS private key, enables HTTPS when set alongside --tls-cert")
+	serverCmd.Flags().StringVar(&options.BasicAuth, "basic-auth", "", "require HTTP basic auth credentials in the form user:pass")
+	serverCmd.Flags().IntVar(&options.Workers, "workers", 2, "number of concurrent chrome invocations the /jobs worker pool may run")
+	serverCmd.Flags().IntVar(&options.QueueSize, "queue-size", 0, "maximum number of pending /jobs before new submissions get a 429 (0 picks workers*4)")
 }
 
 // handler is the HTTP handler for the web service this command exposes
@@ -101,22 +198,30 @@ func handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !options.AllowInsecureURIs {
-		if !strings.HasPrefix(url.Scheme, "http") {
-			http.Error(w, "only http(s) urls are accepted", http.StatusNotAcceptable)
+	if err := validateRequestURL(r, url); err != nil {
+		if errors.Is(err, errInvalidSignature) {
+			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
 	}
 
-	buf, err := chrm.Screenshot(url)
+	format := strings.ToLower(r.URL.Query().Get("format"))
+
+	quality, err := strconv.Atoi(r.URL.Query().Get("quality"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		quality = 0
+	}
+
+	colors, err := strconv.Atoi(r.URL.Query().Get("colors"))
+	if err != nil {
+		colors = 0
 	}
 
-	if width == 0 {
-		w.Header().Set("Content-Type", "image/png")
-		w.Write(buf)
+	buf, err := chrm.Screenshot(url)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -125,12 +230,17 @@ func handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	dstImage := imaging.Fit(img, width, height, imaging.Lanczos)
 
-	w.Header().Set("Content-Type", "image/jpeg")
-	err = jpeg.Encode(w, dstImage, nil)
+	if width > 0 {
+		img = imaging.Fit(img, width, height, imaging.Lanczos)
+	}
+
+	out, contentType, err := encodeImage(img, format, encodeOptions{Quality: quality, Colors: colors})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
 		return
 	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(out)
 }
@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// browseImageTTL is how long a cached screenshot stays available for the
+// follow-up /screenshot?id= request before it is evicted.
+const browseImageTTL = 5 * time.Minute
+
+// browseAnchor describes a clickable region of a rendered page, mapped onto
+// the flattened screenshot image as an HTML imagemap <area>.
+type browseAnchor struct {
+	Href string
+	X1   float64
+	Y1   float64
+	X2   float64
+	Y2   float64
+}
+
+// browseCacheEntry is a single entry in browseImageCache.
+type browseCacheEntry struct {
+	data      []byte
+	mime      string
+	expiresAt time.Time
+}
+
+// browseImageCache holds raw screenshot bytes keyed by a short-lived id, so
+// that the HTML page returned by browseHandler can reference the image via
+// a plain <img src> without re-running chrome.
+var browseImageCache = struct {
+	sync.Mutex
+	entries map[string]browseCacheEntry
+}{entries: make(map[string]browseCacheEntry)}
+
+// newRandomID returns a random 16-byte id, hex encoded, used anywhere a
+// short-lived resource (a cached screenshot, a job) needs an identifier
+// that's unguessable but doesn't need the overhead of a real UUID library.
+func newRandomID() string {
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
+// browseCachePut stores buf under a new random id and returns that id.
+func browseCachePut(buf []byte, mime string) string {
+	id := newRandomID()
+
+	browseImageCache.Lock()
+	browseImageCache.entries[id] = browseCacheEntry{
+		data:      buf,
+		mime:      mime,
+		expiresAt: time.Now().Add(browseImageTTL),
+	}
+	browseImageCache.Unlock()
+
+	return id
+}
+
+// browseCacheGet returns the cached bytes for id, evicting (and reporting a
+// miss for) anything past its TTL.
+func browseCacheGet(id string) (browseCacheEntry, bool) {
+	browseImageCache.Lock()
+	defer browseImageCache.Unlock()
+
+	entry, ok := browseImageCache.entries[id]
+	if !ok {
+		return browseCacheEntry{}, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(browseImageCache.entries, id)
+		return browseCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// browseCacheJanitor periodically sweeps expired entries out of
+// browseImageCache so long running servers don't leak memory.
+func browseCacheJanitor() {
+	for range time.Tick(browseImageTTL) {
+		now := time.Now()
+
+		browseImageCache.Lock()
+		for id, entry := range browseImageCache.entries {
+			if now.After(entry.expiresAt) {
+				delete(browseImageCache.entries, id)
+			}
+		}
+		browseImageCache.Unlock()
+	}
+}
+
+// browseHandler renders the target page, takes a screenshot by driving
+// chromedp directly (not through chrm.Screenshot as handler does), and returns an HTML document with a server-side clickable
+// imagemap so that browsers without JavaScript (or images-only/text
+// browsers) can navigate the web purely by following <area> links, in the
+// spirit of the old Web Rendering Proxy technique.
+func browseHandler(w http.ResponseWriter, r *http.Request) {
+	rawURL := strings.TrimSpace(r.URL.Query().Get("url"))
+	if rawURL == "" {
+		http.Error(w, "url parameter missing. eg ?url=https://google.com", http.StatusNotAcceptable)
+		return
+	}
+
+	width, height := parseWidthHeight(r)
+	if width == 0 {
+		width = 1280
+	}
+	if height == 0 {
+		height = 720
+	}
+
+	page := 0
+	if p, err := strconv.Atoi(r.URL.Query().Get("p")); err == nil && p > 0 {
+		page = p
+	}
+
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := validateRequestURL(r, target); err != nil {
+		if errors.Is(err, errInvalidSignature) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	buf, anchors, err := browseScreenshotWithLinks(target, width, height, page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id := browseCachePut(buf, "image/png")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, browsePageTemplate, html.EscapeString(target.String()), id, width, height, renderBrowseAreas(anchors, target))
+}
+
+// browseScreenshotByIDHandler serves the raw bytes cached by a previous
+// browseHandler call under /screenshot?id=ID.
+func browseScreenshotByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id parameter missing", http.StatusNotAcceptable)
+		return
+	}
+
+	entry, ok := browseCacheGet(id)
+	if !ok {
+		http.Error(w, "screenshot not found or expired", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", entry.mime)
+	w.Write(entry.data)
+}
+
+// browseScreenshotWithLinks takes a screenshot of target and, while the page
+// is still loaded, enumerates anchor bounding rects so they can be rendered
+// as imagemap areas. page, when greater than zero, scrolls down page
+// viewports first so a tall page can be split across several /browse
+// requests.
+//
+// Chrome's traffic for this navigation is routed through ssrfProxy (set up
+// once as HTTP_PROXY/HTTPS_PROXY in serverCmd's Run), which is what
+// actually stops the navigation - including any redirects the page issues
+// - from reaching a disallowed address; see validateRequestURL's doc
+// comment for why an upfront check alone can't do that. On top of that,
+// this function also counts top-level document navigations itself via the
+// CDP Network domain and aborts once more than --max-redirects redirects
+// have been followed, so a malicious or looping redirect chain can't run
+// indefinitely even toward otherwise-allowed hosts.
+func browseScreenshotWithLinks(target *url.URL, width, height, page int) ([]byte, []browseAnchor, error) {
+	ctx, cancel := chromedp.NewContext(context.Background())
+	defer cancel()
+
+	// navigations is written from the ListenTarget callback goroutine and
+	// read from this goroutine after chromedp.Run returns; a plain int
+	// would race on any return path other than the cancellation itself
+	// (e.g. WaitReady failing while a navigation event is still being
+	// processed), so it needs to be atomic.
+	var navigations atomic.Int64
+	maxNavigations := int64(options.MaxRedirects + 1)
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		e, ok := ev.(*network.EventRequestWillBeSent)
+		if !ok || e.Type != network.ResourceTypeDocument {
+			return
+		}
+		if navigations.Add(1) > maxNavigations {
+			cancel()
+		}
+	})
+
+	var buf []byte
+	var anchors []browseAnchor
+
+	actions := []chromedp.Action{
+		emulation.SetDeviceMetricsOverride(int64(width), int64(height), 1, false),
+		chromedp.Navigate(target.String()),
+		chromedp.WaitReady("body"),
+	}
+
+	if page > 0 {
+		actions = append(actions, chromedp.Evaluate(fmt.Sprintf("window.scrollTo(0, %d)", page*height), nil))
+	}
+
+	actions = append(actions,
+		chromedp.Evaluate(browseAnchorScript, &anchors),
+		chromedp.CaptureScreenshot(&buf),
+	)
+
+	if err := chromedp.Run(ctx, actions...); err != nil {
+		if navigations.Load() > maxNavigations {
+			return nil, nil, fmt.Errorf("exceeded --max-redirects (%d) following %q", options.MaxRedirects, target)
+		}
+		return nil, nil, err
+	}
+
+	return buf, anchors, nil
+}
+
+// browseAnchorScript is evaluated in the page to collect every anchor's
+// href and its bounding rect, relative to the current (possibly scrolled)
+// viewport, matching what CaptureScreenshot rasterises.
+const browseAnchorScript = `
+(function () {
+	var out = [];
+	document.querySelectorAll('a[href]').forEach(function (a) {
+		var r = a.getBoundingClientRect();
+		if (r.width <= 0 || r.height <= 0) {
+			return;
+		}
+		out.push({Href: a.href, X1: r.left, Y1: r.top, X2: r.right, Y2: r.bottom});
+	});
+	return out;
+})()
+`
+
+// browsePageTemplate is the HTML shell returned by browseHandler. Its
+// placeholders are, in order: the page title/url, the cached image id,
+// width, height, and the rendered <area> tags.
+const browsePageTemplate = `<!DOCTYPE html>
+<html>
+<head><title>%s</title></head>
+<body>
+<img src="/screenshot?id=%s" usemap="#m" width="%d" height="%d" border="0">
+<map name="m">
+%s</map>
+</body>
+</html>
+`
+
+// renderBrowseAreas turns anchors into <area> tags, rewriting each href so
+// that following it issues another /browse request rather than navigating
+// the client away.
+func renderBrowseAreas(anchors []browseAnchor, base *url.URL) string {
+	var b strings.Builder
+	for _, a := range anchors {
+		resolved, err := base.Parse(a.Href)
+		if err != nil {
+			continue
+		}
+
+		b.WriteString(fmt.Sprintf(
+			`<area shape="rect" coords="%d,%d,%d,%d" href="/browse?url=%s">`+"\n",
+			int(a.X1), int(a.Y1), int(a.X2), int(a.Y2), url.QueryEscape(resolved.String()),
+		))
+	}
+	return b.String()
+}
+
+// parseWidthHeight reads the width/height query parameters the same way
+// handler does, returning 0, 0 when either is absent or invalid.
+func parseWidthHeight(r *http.Request) (int, int) {
+	width, err := strconv.Atoi(r.URL.Query().Get("width"))
+	if err != nil || width < 1 {
+		width = 0
+	}
+
+	height, err := strconv.Atoi(r.URL.Query().Get("height"))
+	if err != nil || height < 1 {
+		height = 0
+	}
+
+	if width == 0 || height == 0 {
+		return 0, 0
+	}
+
+	return width, height
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseWidthHeight(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantWidth  int
+		wantHeight int
+	}{
+		{"both set", "width=800&height=600", 800, 600},
+		{"missing both", "", 0, 0},
+		{"width without height", "width=800", 0, 0},
+		{"non-numeric", "width=foo&height=bar", 0, 0},
+		{"negative", "width=-1&height=-1", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/browse?"+tt.query, nil)
+			width, height := parseWidthHeight(req)
+			if width != tt.wantWidth || height != tt.wantHeight {
+				t.Errorf("parseWidthHeight() = (%d, %d), want (%d, %d)", width, height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestRenderBrowseAreas(t *testing.T) {
+	base, err := url.Parse("https://example.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anchors := []browseAnchor{
+		{Href: "/other", X1: 1, Y1: 2, X2: 11, Y2: 22},
+		{Href: "https://elsewhere.example/x?y=1", X1: 5, Y1: 6, X2: 15, Y2: 26},
+	}
+
+	out := renderBrowseAreas(anchors, base)
+
+	want := `<area shape="rect" coords="1,2,11,22" href="/browse?url=https%3A%2F%2Fexample.com%2Fother">` + "\n" +
+		`<area shape="rect" coords="5,6,15,26" href="/browse?url=https%3A%2F%2Felsewhere.example%2Fx%3Fy%3D1">` + "\n"
+
+	if out != want {
+		t.Errorf("renderBrowseAreas() = %q, want %q", out, want)
+	}
+}
+
+func TestBrowseHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{"missing url", "", http.StatusNotAcceptable},
+		{"private address rejected", "url=http://127.0.0.1/", http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/browse?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			browseHandler(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestBrowseHandlerRequiresSignatureWhenHMACKeySet(t *testing.T) {
+	options.HMACKey = "test-secret"
+	defer func() { options.HMACKey = "" }()
+
+	req := httptest.NewRequest(http.MethodGet, "/browse?url=https://example.com", nil)
+	w := httptest.NewRecorder()
+	browseHandler(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusForbidden, w.Body.String())
+	}
+}
+
+// browseScreenshotWithLinks's redirect-cap enforcement drives a real chrome
+// instance via chromedp and counts live navigation events; there's no seam
+// to exercise that without either a running browser or adding production
+// code solely to make it fakeable, so it isn't covered here. The validation
+// that runs before chrome is ever invoked (above) is what's testable
+// without one.
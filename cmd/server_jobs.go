@@ -0,0 +1,350 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+	"github.com/disintegration/imaging"
+)
+
+// jobStatus is the lifecycle state of an async screenshot job.
+type jobStatus string
+
+const (
+	jobPending jobStatus = "pending"
+	jobRunning jobStatus = "running"
+	jobDone    jobStatus = "done"
+	jobFailed  jobStatus = "failed"
+)
+
+// jobRequest is the JSON body accepted by POST /jobs.
+type jobRequest struct {
+	URL             string `json:"url"`
+	Width           int    `json:"width"`
+	Height          int    `json:"height"`
+	Format          string `json:"format"`
+	Quality         int    `json:"quality"`
+	Colors          int    `json:"colors"`
+	WaitForSelector string `json:"wait_for_selector"`
+	DelayMS         int    `json:"delay_ms"`
+	CallbackURL     string `json:"callback_url"`
+	Sig             string `json:"sig"`
+}
+
+// job tracks one POST /jobs request from submission through to completion.
+type job struct {
+	ID  string
+	req jobRequest
+
+	mu          sync.Mutex
+	status      jobStatus
+	image       []byte
+	contentType string
+	errMsg      string
+}
+
+func (j *job) snapshot() (jobStatus, []byte, string, string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status, j.image, j.contentType, j.errMsg
+}
+
+func (j *job) setRunning() {
+	j.mu.Lock()
+	j.status = jobRunning
+	j.mu.Unlock()
+}
+
+func (j *job) setDone(imgBytes []byte, contentType string) {
+	j.mu.Lock()
+	j.status = jobDone
+	j.image = imgBytes
+	j.contentType = contentType
+	j.mu.Unlock()
+}
+
+func (j *job) setFailed(err error) {
+	j.mu.Lock()
+	j.status = jobFailed
+	j.errMsg = err.Error()
+	j.mu.Unlock()
+}
+
+// jobStore holds every job this process knows about, keyed by id. Entries
+// are never evicted here; operators that care about long-term memory use
+// should restart periodically or front this with their own TTL, same as
+// browseImageCache does for /browse.
+var jobStore = struct {
+	sync.Mutex
+	jobs map[string]*job
+}{jobs: make(map[string]*job)}
+
+// jobQueue is the bounded work queue jobsCreateHandler feeds and
+// startJobWorkers drains. Its capacity is --queue-size.
+var jobQueue chan *job
+var jobQueueOnce sync.Once
+
+// startJobWorkers lazily creates the bounded queue and launches n worker
+// goroutines that serialize chrome invocations, so a burst of job
+// submissions can't spin up unbounded concurrent chrome tabs.
+func startJobWorkers(n, queueSize int) {
+	jobQueueOnce.Do(func() {
+		if n < 1 {
+			n = 1
+		}
+		if queueSize < 1 {
+			queueSize = n * 4
+		}
+
+		jobQueue = make(chan *job, queueSize)
+		for i := 0; i < n; i++ {
+			go jobWorker()
+		}
+	})
+}
+
+// jobWorker pulls jobs off jobQueue and runs them one at a time.
+func jobWorker() {
+	for j := range jobQueue {
+		runJob(j)
+	}
+}
+
+// jobsCreateHandler implements POST /jobs: it validates the request,
+// enqueues it, and returns immediately with a status URL the caller can
+// poll, rather than blocking an HTTP goroutine and a chrome tab for
+// however long the screenshot takes.
+func jobsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req jobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid json body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	rawURL := strings.TrimSpace(req.URL)
+	if rawURL == "" {
+		http.Error(w, "url is required", http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if options.HMACKey != "" {
+		if err := verifyHMACSignature(target.String(), req.Sig); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := validateTargetURL(target); err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	j := &job{ID: newRandomID(), req: req, status: jobPending}
+
+	jobStore.Lock()
+	jobStore.jobs[j.ID] = j
+	jobStore.Unlock()
+
+	select {
+	case jobQueue <- j:
+	default:
+		jobStore.Lock()
+		delete(jobStore.jobs, j.ID)
+		jobStore.Unlock()
+		http.Error(w, "job queue is full, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":         j.ID,
+		"status_url": "/jobs/" + j.ID,
+	})
+}
+
+// jobsStatusHandler implements GET /jobs/{id}: while the job is pending or
+// running it returns its status as JSON, and once done serves the image
+// directly (or the failure reason, for a failed job).
+func jobsStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if id == "" {
+		http.Error(w, "job id missing from path", http.StatusNotAcceptable)
+		return
+	}
+
+	jobStore.Lock()
+	j, ok := jobStore.jobs[id]
+	jobStore.Unlock()
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	status, imgBytes, contentType, errMsg := j.snapshot()
+
+	switch status {
+	case jobDone:
+		w.Header().Set("Content-Type", contentType)
+		w.Write(imgBytes)
+	case jobFailed:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{"id": id, "status": string(status), "error": errMsg})
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"id": id, "status": string(status)})
+	}
+}
+
+// runJob takes the screenshot for j using the same format/quality/colors
+// pipeline as handler, then notifies req.CallbackURL if one was given.
+func runJob(j *job) {
+	j.setRunning()
+
+	result, contentType, err := captureJobImage(j.req)
+	if err != nil {
+		j.setFailed(err)
+		j.postCallback(nil, "", err)
+		return
+	}
+
+	j.setDone(result, contentType)
+	j.postCallback(result, contentType, nil)
+}
+
+// captureJobImage navigates to req.URL and encodes the result per
+// req.Format/Quality/Colors. Unlike handler's chrm.Screenshot, this drives
+// chromedp directly (the same approach server_browse.go uses) so that
+// req.WaitForSelector and req.DelayMS can apply as real rendering-settle
+// conditions on the loaded page, rather than a sleep before navigation even
+// starts.
+func captureJobImage(req jobRequest) ([]byte, string, error) {
+	target, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil {
+		return nil, "", err
+	}
+
+	buf, err := captureJobScreenshot(target, req.Width, req.Height, req.WaitForSelector, time.Duration(req.DelayMS)*time.Millisecond)
+	if err != nil {
+		return nil, "", err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if req.Width > 0 && req.Height > 0 {
+		img = imaging.Fit(img, req.Width, req.Height, imaging.Lanczos)
+	}
+
+	return encodeImage(img, strings.ToLower(req.Format), encodeOptions{Quality: req.Quality, Colors: req.Colors})
+}
+
+// captureJobScreenshot navigates to target and returns the raw screenshot
+// bytes. waitForSelector, when set, waits for that selector to become
+// visible before capturing; delay, when positive, additionally sleeps that
+// long first - both run after the page has loaded, as a settle condition
+// for the capture, not as a delay before navigation begins. Chrome's
+// traffic here is routed through ssrfProxy the same way as any other
+// chrome invocation this server makes; see server_browse.go's doc comment
+// on browseScreenshotWithLinks for why that's what actually constrains
+// where it's allowed to connect.
+func captureJobScreenshot(target *url.URL, width, height int, waitForSelector string, delay time.Duration) ([]byte, error) {
+	ctx, cancel := chromedp.NewContext(context.Background())
+	defer cancel()
+
+	var actions []chromedp.Action
+	if width > 0 && height > 0 {
+		actions = append(actions, emulation.SetDeviceMetricsOverride(int64(width), int64(height), 1, false))
+	}
+	actions = append(actions, chromedp.Navigate(target.String()), chromedp.WaitReady("body"))
+
+	if waitForSelector != "" {
+		actions = append(actions, chromedp.WaitVisible(waitForSelector))
+	}
+	if delay > 0 {
+		actions = append(actions, chromedp.Sleep(delay))
+	}
+
+	var buf []byte
+	actions = append(actions, chromedp.CaptureScreenshot(&buf))
+
+	if err := chromedp.Run(ctx, actions...); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// callbackClient is used for every callback POST. It needs its own bounded
+// timeout rather than http.DefaultClient's none: callback_url is attacker
+// controlled (validated for scheme/private-IP, not responsiveness), and
+// postCallback runs synchronously inside the worker goroutine that handles
+// it, so a callback endpoint that accepts the connection and never replies
+// would otherwise wedge that worker - and, with a small --workers count,
+// the whole pool - forever.
+var callbackClient = &http.Client{Timeout: 10 * time.Second}
+
+// postCallback POSTs a small JSON result envelope to req.CallbackURL, when
+// set, once the job finishes. Raw image bytes aren't practical to embed in
+// JSON, so callers that want them fetch status_url; the callback just
+// tells them the job is ready (or why it isn't).
+func (j *job) postCallback(imgBytes []byte, contentType string, jobErr error) {
+	if j.req.CallbackURL == "" {
+		return
+	}
+
+	callbackURL, err := url.Parse(j.req.CallbackURL)
+	if err != nil {
+		return
+	}
+	if err := validateTargetURL(callbackURL); err != nil {
+		return
+	}
+
+	payload := map[string]string{
+		"id":         j.ID,
+		"status_url": "/jobs/" + j.ID,
+	}
+	if jobErr != nil {
+		payload["status"] = string(jobFailed)
+		payload["error"] = jobErr.Error()
+	} else {
+		payload["status"] = string(jobDone)
+		payload["content_type"] = contentType
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	resp, err := callbackClient.Post(callbackURL.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postJob is a small helper that POSTs body to jobsCreateHandler and returns
+// the recorded response.
+func postJob(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	jobsCreateHandler(w, req)
+	return w
+}
+
+func TestJobsCreateHandlerValidation(t *testing.T) {
+	jobQueue = make(chan *job, 1)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"invalid json", `{not json`, http.StatusBadRequest},
+		{"missing url", `{}`, http.StatusBadRequest},
+		{"private address rejected", `{"url":"http://127.0.0.1/"}`, http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJob(t, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestJobsCreateHandlerRequiresSignatureWhenHMACKeySet(t *testing.T) {
+	options.HMACKey = "test-secret"
+	defer func() { options.HMACKey = "" }()
+
+	jobQueue = make(chan *job, 1)
+
+	w := postJob(t, `{"url":"https://example.com"}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusForbidden, w.Body.String())
+	}
+}
+
+func TestJobsCreateHandlerQueueFull(t *testing.T) {
+	jobQueue = make(chan *job, 1)
+	jobQueue <- &job{ID: "filler"}
+
+	w := postJob(t, `{"url":"https://example.com"}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusTooManyRequests, w.Body.String())
+	}
+}
+
+func TestJobsCreateHandlerAccepted(t *testing.T) {
+	jobQueue = make(chan *job, 1)
+
+	w := postJob(t, `{"url":"https://example.com"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusAccepted, w.Body.String())
+	}
+
+	var resp map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp["id"] == "" {
+		t.Fatalf("response missing id: %v", resp)
+	}
+	if resp["status_url"] != "/jobs/"+resp["id"] {
+		t.Errorf("status_url = %q, want %q", resp["status_url"], "/jobs/"+resp["id"])
+	}
+
+	jobStore.Lock()
+	_, ok := jobStore.jobs[resp["id"]]
+	jobStore.Unlock()
+	if !ok {
+		t.Errorf("job %s was not recorded in jobStore", resp["id"])
+	}
+
+	select {
+	case queued := <-jobQueue:
+		if queued.ID != resp["id"] {
+			t.Errorf("queued job id = %q, want %q", queued.ID, resp["id"])
+		}
+	default:
+		t.Error("job was not enqueued onto jobQueue")
+	}
+}
+
+// captureJobImage's actual navigation path (captureJobScreenshot) drives a
+// real chrome instance via chromedp and isn't exercised here, the same way
+// this package's other chrome-dependent paths (browseScreenshotWithLinks)
+// aren't - there's no seam to fake chrome out without either a running
+// browser or changing production code just to make it testable.
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// securityHeaders wraps next, adding the hardening headers that make the
+// "expose this server to other networks is dangerous" warning in the
+// server command's help actionable: callers get sane defaults rather than
+// having to remember to add them behind a reverse proxy.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("Content-Security-Policy", cspFor(r.URL.Path))
+		if r.TLS != nil {
+			h.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cspFor picks the Content-Security-Policy for path. /browse renders an
+// HTML page that loads its screenshot via <img src="/screenshot?...">, so
+// it needs img-src scoped to 'self'; every other response (raw images, job
+// JSON) has nothing to load and keeps the fully locked down default.
+func cspFor(path string) string {
+	if path == "/browse" {
+		return "default-src 'none'; img-src 'self'"
+	}
+	return "default-src 'none'"
+}
+
+// basicAuth wraps next, requiring the "user:pass" credentials given via
+// --basic-auth when set. It's a no-op when the flag is empty.
+func basicAuth(next http.Handler) http.Handler {
+	if options.BasicAuth == "" {
+		return next
+	}
+
+	user, pass, ok := parseBasicAuthFlag(options.BasicAuth)
+	if !ok {
+		log := options.Logger
+		log.Fatal().Msg("--basic-auth must be in the form user:pass")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotPass, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(gotUser), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(gotPass), []byte(pass)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gowitness"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseBasicAuthFlag splits "user:pass" into its two parts.
+func parseBasicAuthFlag(v string) (user, pass string, ok bool) {
+	for i := 0; i < len(v); i++ {
+		if v[i] == ':' {
+			return v[:i], v[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// rateLimiterIdleTTL is how long a client's bucket can go unused before
+// rateLimiter's janitor evicts it. Without this, a rate limiter protecting
+// a publicly-exposed server - the entire point of --rps/--burst - would
+// itself grow without bound as distinct client IPs come and go, the same
+// kind of leak browseImageCache's janitor already guards against.
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// rateLimiter is a simple per-client token bucket, keyed by the request's
+// remote IP, used to implement --rps/--burst.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rps     float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	rl := &rateLimiter{
+		rps:     rps,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+	go rl.janitor()
+	return rl
+}
+
+// janitor periodically evicts buckets that have been idle for longer than
+// rateLimiterIdleTTL.
+func (rl *rateLimiter) janitor() {
+	for range time.Tick(rateLimiterIdleTTL) {
+		now := time.Now()
+
+		rl.mu.Lock()
+		for key, b := range rl.buckets {
+			if now.Sub(b.lastSeen) > rateLimiterIdleTTL {
+				delete(rl.buckets, key)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// allow reports whether a request from key may proceed, deducting a token
+// from its bucket if so.
+func (rl *rateLimiter) allow(key string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: rl.burst, lastSeen: now}
+		rl.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.lastSeen).Seconds()
+	b.lastSeen = now
+	b.tokens += elapsed * rl.rps
+	if b.tokens > rl.burst {
+		b.tokens = rl.burst
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// rateLimit wraps next, rejecting requests over --rps/--burst for a given
+// client IP with 429. A nil *rateLimiter (rps <= 0) disables the check.
+func rateLimit(rl *rateLimiter, next http.Handler) http.Handler {
+	if rl == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		if !rl.allow(host) {
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	rl := newRateLimiter(1, 3)
+
+	key := "1.2.3.4"
+
+	// Burst of 3 should be allowed back to back, the 4th should not.
+	for i := 0; i < 3; i++ {
+		if !rl.allow(key) {
+			t.Fatalf("request %d within burst was denied", i+1)
+		}
+	}
+	if rl.allow(key) {
+		t.Fatalf("request beyond burst was allowed")
+	}
+
+	// After waiting long enough to refill roughly one token (rps=1), one
+	// more request should be allowed, and the next right after it denied.
+	time.Sleep(1100 * time.Millisecond)
+	if !rl.allow(key) {
+		t.Fatalf("request after a ~1s refill was denied")
+	}
+	if rl.allow(key) {
+		t.Fatalf("a second request immediately after the refill was allowed")
+	}
+
+	// A different key has its own, independent bucket.
+	if !rl.allow("5.6.7.8") {
+		t.Fatalf("a fresh key was denied its first request")
+	}
+}
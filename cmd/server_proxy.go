@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ssrfProxy is a small forward proxy that chrome is pointed at (via the
+// HTTPS_PROXY/HTTP_PROXY environment variables, set once in serverCmd's
+// Run before any chrome process - ours or chrm's - is started) so that
+// every single connection chrome makes, including ones made mid-navigation
+// to follow a redirect, is validated and dialed by IP at the exact moment
+// of connecting.
+//
+// validateHost alone can't close this gap: it resolves a host once, up
+// front, and then trusts whatever chrome connects to moments later -
+// which may have resolved differently (DNS rebinding), and says nothing
+// at all about redirects chrome's own navigation follows afterwards,
+// since those never pass back through our validation code. Routing
+// chrome's traffic through this proxy means there is no "check, then
+// later, separately, connect" gap to exploit: the resolution and the
+// connection are the same step, for every hop.
+type ssrfProxy struct {
+	listener net.Listener
+}
+
+var (
+	globalSSRFProxy     *ssrfProxy
+	globalSSRFProxyOnce sync.Once
+	globalSSRFProxyErr  error
+)
+
+// ensureSSRFProxy starts the shared validating proxy on first use and
+// returns it on every subsequent call.
+func ensureSSRFProxy() (*ssrfProxy, error) {
+	globalSSRFProxyOnce.Do(func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			globalSSRFProxyErr = err
+			return
+		}
+
+		p := &ssrfProxy{listener: ln}
+		go http.Serve(ln, http.HandlerFunc(p.serveHTTP))
+		globalSSRFProxy = p
+	})
+
+	return globalSSRFProxy, globalSSRFProxyErr
+}
+
+// addr returns the proxy's "host:port" listening address.
+func (p *ssrfProxy) addr() string {
+	return p.listener.Addr().String()
+}
+
+func (p *ssrfProxy) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.serveConnect(w, r)
+		return
+	}
+	p.serveHTTPForward(w, r)
+}
+
+// serveConnect handles HTTPS traffic: chrome asks to CONNECT to a host:port,
+// we validate and dial it ourselves, then splice the two connections
+// together byte for byte. TLS itself is still negotiated end-to-end
+// between chrome and the origin; we only gate which IP the tunnel goes to.
+func (p *ssrfProxy) serveConnect(w http.ResponseWriter, r *http.Request) {
+	dst, err := dialValidated(r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		dst.Close()
+		http.Error(w, "proxy does not support hijacking", http.StatusInternalServerError)
+		return
+	}
+
+	clientConn, _, err := hj.Hijack()
+	if err != nil {
+		dst.Close()
+		return
+	}
+
+	clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); io.Copy(dst, clientConn) }()
+	go func() { defer wg.Done(); io.Copy(clientConn, dst) }()
+	wg.Wait()
+
+	dst.Close()
+	clientConn.Close()
+}
+
+// serveHTTPForward handles plain-http traffic the same way: dial the
+// validated, resolved address ourselves rather than letting the transport
+// re-resolve the host later.
+func (p *ssrfProxy) serveHTTPForward(w http.ResponseWriter, r *http.Request) {
+	hostport := r.Host
+	if !strings.Contains(hostport, ":") {
+		hostport = net.JoinHostPort(hostport, "80")
+	}
+
+	dst, err := dialValidated(hostport)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer dst.Close()
+
+	if err := r.WriteProxy(dst); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(dst), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for key, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// dialValidated resolves the host in hostport, rejects it under the same
+// allow/deny lists validateHost applies, skips any resolved address that
+// is private/reserved (unless --allow-private is set) and dials the first
+// remaining IP that answers directly - so the address that was just
+// validated is the address that's actually connected to, with no window in
+// between for a re-resolution to change the answer. Unlike validateHost, a
+// host with both private and public addresses is not rejected outright;
+// only its public addresses are tried.
+func dialValidated(hostport string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = hostport, "443"
+	}
+
+	if len(options.DenyHosts) > 0 && matchesAnyHostPattern(host, options.DenyHosts) {
+		return nil, fmt.Errorf("host %q is denied", host)
+	}
+	if len(options.AllowHosts) > 0 && !matchesAnyHostPattern(host, options.AllowHosts) {
+		return nil, fmt.Errorf("host %q is not in the allow-host list", host)
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve host %q: %w", host, err)
+	}
+
+	for _, ip := range ips {
+		if !options.AllowPrivate && isPrivateOrReservedIP(ip) {
+			continue
+		}
+
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), port), 10*time.Second)
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, fmt.Errorf("host %q has no permitted, reachable address", host)
+}
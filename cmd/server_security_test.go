@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPrivateOrReservedIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{"public ipv4", "8.8.8.8", false},
+		{"public ipv4 boundary below private 10/8", "9.255.255.255", false},
+		{"rfc1918 10/8", "10.0.0.1", true},
+		{"rfc1918 172.16/12", "172.16.0.1", true},
+		{"just below 172.16/12", "172.15.255.255", false},
+		{"rfc1918 192.168/16", "192.168.1.1", true},
+		{"loopback ipv4", "127.0.0.1", true},
+		{"link-local ipv4", "169.254.1.1", true},
+		{"cgnat 100.64/10", "100.64.0.1", true},
+		{"just below cgnat", "100.63.255.255", false},
+		{"just above cgnat range", "100.128.0.1", false},
+		{"loopback ipv6", "::1", true},
+		{"link-local ipv6", "fe80::1", true},
+		{"unique local ipv6 fc00", "fc00::1", true},
+		{"unique local ipv6 fdff", "fdff::1", true},
+		{"public ipv6", "2001:4860:4860::8888", false},
+		{"unspecified ipv4", "0.0.0.0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			if ip == nil {
+				t.Fatalf("net.ParseIP(%q) returned nil", tt.ip)
+			}
+			if got := isPrivateOrReservedIP(ip); got != tt.want {
+				t.Errorf("isPrivateOrReservedIP(%q) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesAnyHostPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		patterns []string
+		want     bool
+	}{
+		{"empty patterns never match", "example.com", nil, false},
+		{"exact glob match", "example.com", []string{"example.com"}, true},
+		{"glob wildcard match", "foo.example.com", []string{"*.example.com"}, true},
+		{"glob wildcard no match", "example.com", []string{"*.example.com"}, false},
+		{"regex match", "example.com", []string{"~^example\\.(com|net)$"}, true},
+		{"regex no match", "example.org", []string{"~^example\\.(com|net)$"}, false},
+		{"matches any of several patterns", "b.internal", []string{"a.internal", "b.internal"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesAnyHostPattern(tt.host, tt.patterns); got != tt.want {
+				t.Errorf("matchesAnyHostPattern(%q, %v) = %v, want %v", tt.host, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyHMACSignature(t *testing.T) {
+	options.HMACKey = "test-secret"
+	defer func() { options.HMACKey = "" }()
+
+	rawURL := "https://example.com/?q=1"
+	// hex(HMAC-SHA256("test-secret", rawURL))
+	validSig := "518b418f6a59675bff86c5c6a964a3e285afd1991f0e4d6f37aa7605d0f2d0cf"
+
+	tests := []struct {
+		name    string
+		sig     string
+		wantErr bool
+	}{
+		{"missing signature", "", true},
+		{"not hex", "not-hex!!", true},
+		{"wrong signature", "00112233445566778899aabbccddeeff00112233445566778899aabbccddee", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyHMACSignature(rawURL, tt.sig); (err != nil) != tt.wantErr {
+				t.Errorf("verifyHMACSignature(%q) error = %v, wantErr %v", tt.sig, err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := verifyHMACSignature(rawURL, validSig); err != nil {
+		t.Errorf("verifyHMACSignature with a correctly computed signature returned an error: %v", err)
+	}
+}